@@ -16,31 +16,98 @@ package statestore
 
 import (
 	"context"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-redis/redis/v9"
 	"github.com/golang/protobuf/proto"
-	"github.com/gomodule/redigo/redis"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"open-match.dev/open-match/internal/ipb"
+	"open-match.dev/open-match/internal/statestore/scripts"
 	"open-match.dev/open-match/pkg/pb"
 )
 
-const (
-	backfillLastAckTime = "backfill_last_ack_time"
-	allBackfills        = "allBackfills"
+var logger = logrus.WithFields(logrus.Fields{
+	"app":       "openmatch",
+	"component": "statestore",
+})
+
+// backfillLastAckTime, allBackfills, and backfillCreateTime are built
+// through clusterKeyTag so that, under Redis Cluster, they and the
+// per-backfill keys built by backfillDataKey/backfillExpiryKey/
+// backfillIndexedFieldsKey below always resolve to the same slot. This keeps
+// the multi-key Lua scripts in the scripts subpackage, as well as the
+// pipelined sequences in indexBackfillAttributes/deindexBackfillAttributes,
+// safe to run as a single cluster round trip. They are declared as vars
+// rather than consts because clusterKeyTag is a function.
+var (
+	backfillLastAckTime = clusterKeyTag("backfill_last_ack_time")
+	allBackfills        = clusterKeyTag("allBackfills")
+	backfillCreateTime  = clusterKeyTag("backfill_create_time")
+
+	// backfillTagKeyPrefix distinguishes Set-typed index keys (tags) from
+	// Sorted-Set-typed ones (numeric attributes, create time) when cleaning
+	// up a deindexed backfill's entries.
+	backfillTagKeyPrefix = clusterKeyTag("backfill_tag:")
+
+	// backfillAckKeyPrefix namespaces the per-backfill keys that carry a PX
+	// TTL and back WatchExpiredBackfills. They hold no meaningful value;
+	// their only purpose is to generate a keyspace expiry event.
+	backfillAckKeyPrefix = clusterKeyTag("backfill:ack:")
+
+	// backfillDataKeyPrefix namespaces the key each Backfill's marshalled
+	// payload is stored under. It used to be the bare backfill id, but that
+	// left it in a different cluster slot than allBackfills/
+	// backfillLastAckTime, so any script or pipeline touching both would be
+	// rejected with CROSSSLOT under Redis Cluster.
+	backfillDataKeyPrefix = clusterKeyTag("backfill:")
 )
 
+// backfillDataKey returns the key a Backfill's marshalled payload is stored
+// under.
+func backfillDataKey(id string) string {
+	return backfillDataKeyPrefix + id
+}
+
+// backfillExpiryKey returns the key whose expiry WatchExpiredBackfills
+// watches for a given backfill id.
+func backfillExpiryKey(id string) string {
+	return backfillAckKeyPrefix + id
+}
+
+// backfillAttrKey returns the key of the sorted set that indexes backfill
+// ids by the numeric search field attr (e.g. "open_slots").
+func backfillAttrKey(attr string) string {
+	return clusterKeyTag("backfill_attr:" + attr)
+}
+
+// backfillTagKey returns the key of the set that indexes backfill ids
+// carrying the given search field tag.
+func backfillTagKey(tag string) string {
+	return backfillTagKeyPrefix + tag
+}
+
+// backfillIndexedFieldsKey tracks which attribute/tag keys a given backfill
+// id was indexed under, so DeindexBackfill can clean them up without needing
+// the full Backfill proto back.
+func backfillIndexedFieldsKey(id string) string {
+	return clusterKeyTag("backfill_indexed_fields:" + id)
+}
+
 // CreateBackfill creates a new Backfill in the state storage if one doesn't exist. The xids algorithm used to create the ids ensures that they are unique with no system wide synchronization. Calling clients are forbidden from choosing an id during create. So no conflicts will occur.
+//
+// The SETNX, ack ZADD, and ack expiry SET this used to run as three separate
+// commands now run as the scripts.CreateBackfill Lua script, so a failure
+// partway through can no longer leave the backfill stored but unacknowledged.
+// Indexing is a separate, explicit IndexBackfill call, same as for the etcd
+// backend.
 func (rb *redisBackend) CreateBackfill(ctx context.Context, backfill *pb.Backfill, ticketIDs []string) error {
-	redisConn, err := rb.redisPool.GetContext(ctx)
-	if err != nil {
-		return status.Errorf(codes.Unavailable, "CreateBackfill, id: %s, failed to connect to redis: %v", backfill.GetId(), err)
-	}
-	defer handleConnectionClose(&redisConn)
-
 	bf := ipb.BackfillInternal{
 		Backfill:  backfill,
 		TicketIds: ticketIDs,
@@ -52,31 +119,28 @@ func (rb *redisBackend) CreateBackfill(ctx context.Context, backfill *pb.Backfil
 		return status.Errorf(codes.Internal, "%v", err)
 	}
 
-	res, err := redisConn.Do("SETNX", backfill.GetId(), value)
+	res, err := scripts.CreateBackfill.Run(ctx, rb.rdb,
+		[]string{backfillDataKey(backfill.GetId()), backfillLastAckTime, backfillExpiryKey(backfill.GetId())},
+		value, time.Now().UnixNano(), rb.ackTTL().Milliseconds(), backfill.GetId(),
+	)
 	if err != nil {
-		err = errors.Wrapf(err, "failed to set the value for backfill, id: %s", backfill.GetId())
+		err = errors.Wrapf(err, "failed to create backfill, id: %s", backfill.GetId())
 		return status.Errorf(codes.Internal, "%v", err)
 	}
 
-	if res.(int64) == 0 {
+	if created, _ := res.(int64); created == 0 {
 		return status.Errorf(codes.AlreadyExists, "backfill already exists, id: %s", backfill.GetId())
 	}
 
-	return acknowledgeBackfill(redisConn, backfill.GetId())
+	return nil
 }
 
 // GetBackfill gets the Backfill with the specified id from state storage. This method fails if the Backfill does not exist. Returns the Backfill and associated ticketIDs if they exist.
 func (rb *redisBackend) GetBackfill(ctx context.Context, id string) (*pb.Backfill, []string, error) {
-	redisConn, err := rb.redisPool.GetContext(ctx)
-	if err != nil {
-		return nil, nil, status.Errorf(codes.Unavailable, "GetBackfill, id: %s, failed to connect to redis: %v", id, err)
-	}
-	defer handleConnectionClose(&redisConn)
-
-	value, err := redis.Bytes(redisConn.Do("GET", id))
+	value, err := rb.rdb.Get(ctx, backfillDataKey(id)).Bytes()
 	if err != nil {
-		// Return NotFound if redigo did not find the backfill in storage.
-		if err == redis.ErrNil {
+		// Return NotFound if go-redis did not find the backfill in storage.
+		if err == redis.Nil {
 			return nil, nil, status.Errorf(codes.NotFound, "Backfill id: %s not found", id)
 		}
 
@@ -99,30 +163,30 @@ func (rb *redisBackend) GetBackfill(ctx context.Context, id string) (*pb.Backfil
 }
 
 // DeleteBackfill removes the Backfill with the specified id from state storage. This method succeeds if the Backfill does not exist.
+//
+// Runs as the scripts.DeleteBackfill Lua script so the DEL and its matching
+// ack ZREM can't be observed half-applied. Like CreateBackfill, this does
+// not touch the index; callers that need a deleted backfill removed from
+// the index must call DeindexBackfill themselves.
 func (rb *redisBackend) DeleteBackfill(ctx context.Context, id string) error {
-	redisConn, err := rb.redisPool.GetContext(ctx)
-	if err != nil {
-		return status.Errorf(codes.Unavailable, "DeleteBackfill, id: %s, failed to connect to redis: %v", id, err)
-	}
-	defer handleConnectionClose(&redisConn)
-
-	_, err = redisConn.Do("DEL", id)
+	_, err := scripts.DeleteBackfill.Run(ctx, rb.rdb,
+		[]string{backfillDataKey(id), backfillLastAckTime, backfillExpiryKey(id)},
+		id,
+	)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to delete the backfill from state storage, id: %s", id)
 		return status.Errorf(codes.Internal, "%v", err)
 	}
 
-	return rb.deleteExpiredBackfillID(redisConn, id)
+	return nil
 }
 
 // UpdateBackfill updates an existing Backfill with a new data. ticketIDs can be nil.
+//
+// Runs as the scripts.UpdateBackfill Lua script so the payload SET and, for
+// an already-indexed backfill, the index generation HSET always move
+// together.
 func (rb *redisBackend) UpdateBackfill(ctx context.Context, backfill *pb.Backfill, ticketIDs []string) error {
-	redisConn, err := rb.redisPool.GetContext(ctx)
-	if err != nil {
-		return status.Errorf(codes.Unavailable, "UpdateBackfill, id: %s, failed to connect to redis: %v", backfill.GetId(), err)
-	}
-	defer handleConnectionClose(&redisConn)
-
 	bf := ipb.BackfillInternal{
 		Backfill:  backfill,
 		TicketIds: ticketIDs,
@@ -134,55 +198,70 @@ func (rb *redisBackend) UpdateBackfill(ctx context.Context, backfill *pb.Backfil
 		return status.Errorf(codes.Internal, "%v", err)
 	}
 
-	_, err = redisConn.Do("SET", backfill.GetId(), value)
+	res, err := scripts.UpdateBackfill.Run(ctx, rb.rdb,
+		[]string{backfillDataKey(backfill.GetId()), allBackfills},
+		value, backfill.GetId(), backfill.GetGeneration(),
+	)
 	if err != nil {
 		err = errors.Wrapf(err, "failed to set the value for backfill, id: %s", backfill.GetId())
 		return status.Errorf(codes.Internal, "%v", err)
 	}
 
+	if previousGeneration, ok := res.(int64); ok && previousGeneration >= 0 {
+		logger.WithFields(logrus.Fields{
+			"id":                 backfill.GetId(),
+			"previousGeneration": previousGeneration,
+		}).Debug("refreshed generation of an already-indexed backfill")
+	}
+
 	return nil
 }
 
 // AcknowledgeBackfill stores Backfill's last acknowledgement time.
 // Check on Backfill existence should be performed on Frontend side
 func (rb *redisBackend) AcknowledgeBackfill(ctx context.Context, id string) error {
-	redisConn, err := rb.redisPool.GetContext(ctx)
-	if err != nil {
-		return status.Errorf(codes.Unavailable, "AcknowledgeBackfill, id: %s, failed to connect to redis: %v", id, err)
-	}
-	defer handleConnectionClose(&redisConn)
-	return acknowledgeBackfill(redisConn, id)
+	return acknowledgeBackfill(ctx, rb.rdb, id, rb.ackTTL())
+}
+
+// ackTTL is the window a backfill must be reacknowledged within: a fraction
+// 80% of pendingReleaseTimeout. GetExpiredBackfillIDs' ZSET scan and the PX
+// TTL WatchExpiredBackfills relies on both use this same window, so the two
+// mechanisms stay in agreement about what "expired" means.
+func (rb *redisBackend) ackTTL() time.Duration {
+	return rb.cfg.GetDuration("pendingReleaseTimeout") / 5 * 4
 }
 
-func acknowledgeBackfill(conn redis.Conn, backfillID string) error {
+// acknowledgeBackfill records the current time in the backfillLastAckTime
+// ZSET and, so WatchExpiredBackfills can react without polling, sets a
+// companion key with a PX TTL whose expiry Redis publishes as a keyspace
+// event.
+func acknowledgeBackfill(ctx context.Context, rdb redis.UniversalClient, backfillID string, ttl time.Duration) error {
 	currentTime := time.Now().UnixNano()
 
-	_, err := conn.Do("ZADD", backfillLastAckTime, currentTime, backfillID)
-	if err != nil {
+	pipe := rdb.Pipeline()
+	pipe.ZAdd(ctx, backfillLastAckTime, redis.Z{Score: float64(currentTime), Member: backfillID})
+	pipe.Set(ctx, backfillExpiryKey(backfillID), "", ttl)
+
+	if _, err := pipe.Exec(ctx); err != nil {
 		return status.Errorf(codes.Internal, "%v",
 			errors.Wrap(err, "failed to store backfill's last acknowledgement time"))
 	}
 
 	return nil
-
 }
 
 // GetExpiredBackfillIDs gets all backfill IDs which are expired
 func (rb *redisBackend) GetExpiredBackfillIDs(ctx context.Context) ([]string, error) {
-	redisConn, err := rb.redisPool.GetContext(ctx)
-	if err != nil {
-		return nil, status.Errorf(codes.Unavailable, "GetExpiredBackfillIDs, failed to connect to redis: %v", err)
-	}
-	defer handleConnectionClose(&redisConn)
-
-	// Use a fraction 80% of pendingRelease Tickets TTL
-	ttl := rb.cfg.GetDuration("pendingReleaseTimeout") / 5 * 4
+	ttl := rb.ackTTL()
 	curTime := time.Now()
 	endTimeInt := curTime.Add(-ttl).UnixNano()
 	startTimeInt := 0
 
 	// Filter out backfill IDs that are fetched but not assigned within TTL time (ms).
-	expiredBackfillIds, err := redis.Strings(redisConn.Do("ZRANGEBYSCORE", backfillLastAckTime, startTimeInt, endTimeInt))
+	expiredBackfillIds, err := rb.rdb.ZRangeByScore(ctx, backfillLastAckTime, &redis.ZRangeBy{
+		Min: strconv.Itoa(startTimeInt),
+		Max: strconv.FormatInt(endTimeInt, 10),
+	}).Result()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "error getting expired backfills %v", err)
 	}
@@ -190,46 +269,170 @@ func (rb *redisBackend) GetExpiredBackfillIDs(ctx context.Context) ([]string, er
 	return expiredBackfillIds, nil
 }
 
-// deleteExpiredBackfillID deletes expired BackfillID from a sorted set
-func (rb *redisBackend) deleteExpiredBackfillID(conn redis.Conn, backfillID string) error {
+// WatchExpiredBackfills subscribes to Redis keyspace expiry events and emits
+// each expired backfill id as soon as Redis reports it, instead of waiting
+// for the next GetExpiredBackfillIDs poll. The backfillLastAckTime ZSET is
+// left untouched so a consumer that reconnects and misses keyspace events
+// can still recover by falling back to GetExpiredBackfillIDs.
+//
+// This requires the Redis server to have `notify-keyspace-events` including
+// the "Ex" (expired) class enabled; WatchExpiredBackfills checks for that at
+// subscribe time and logs a warning if it's missing, since otherwise the
+// returned channel would simply never receive anything. It subscribes on
+// the logical DB selected by redis.db (keyspaceEventDB), since Redis
+// publishes expiry events on a per-DB keyevent channel and a subscription
+// to the wrong one would silently never deliver either.
+func (rb *redisBackend) WatchExpiredBackfills(ctx context.Context) <-chan string {
+	rb.warnIfKeyspaceNotificationsDisabled(ctx)
+
+	out := make(chan string)
+
+	go func() {
+		defer close(out)
+
+		pubsub := rb.rdb.PSubscribe(ctx, fmt.Sprintf("__keyevent@%d__:expired", keyspaceEventDB(rb.cfg)))
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+
+				id := strings.TrimPrefix(msg.Payload, backfillAckKeyPrefix)
+				if id == msg.Payload {
+					// Not one of ours; some other key expired.
+					continue
+				}
+
+				select {
+				case out <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
 
-	_, err := conn.Do("ZREM", backfillLastAckTime, backfillID)
-	if err != nil {
-		return status.Errorf(codes.Internal, "failed to delete expired backfill ID %s from Sorted Set %s",
-			backfillID, err.Error())
-	}
-	return nil
+	return out
 }
 
-// IndexBackfill adds the backfill to the index.
-func (rb *redisBackend) IndexBackfill(ctx context.Context, backfill *pb.Backfill) error {
-	redisConn, err := rb.redisPool.GetContext(ctx)
+// warnIfKeyspaceNotificationsDisabled checks that the Redis server is
+// configured to publish key expiry events and logs a warning if it isn't,
+// since WatchExpiredBackfills would otherwise silently never receive any.
+func (rb *redisBackend) warnIfKeyspaceNotificationsDisabled(ctx context.Context) {
+	cfg, err := rb.rdb.ConfigGet(ctx, "notify-keyspace-events").Result()
 	if err != nil {
-		return status.Errorf(codes.Unavailable, "IndexBackfill, id: %s, failed to connect to redis: %v", backfill.GetId(), err)
+		logger.WithError(err).Warn("failed to verify redis notify-keyspace-events; WatchExpiredBackfills may never receive any events")
+		return
+	}
+
+	if !hasExpiredKeyspaceEvents(cfg["notify-keyspace-events"]) {
+		logger.Warn("redis notify-keyspace-events does not include key expiry events (\"Ex\"); set it on the redis server or WatchExpiredBackfills will never receive any events")
 	}
-	defer handleConnectionClose(&redisConn)
+}
 
-	err = redisConn.Send("HSET", allBackfills, backfill.Id, backfill.Generation)
+// hasExpiredKeyspaceEvents reports whether a redis notify-keyspace-events
+// flag string enables expired-key keyevent notifications. The flags are
+// unordered and independent: "E" enables keyevent notifications, and either
+// "A" (all classes) or "x" (expired class) enables the expired class, so
+// e.g. "Ex", "xE", and "KEA" all qualify but "gxK" does not (missing "E").
+func hasExpiredKeyspaceEvents(flags string) bool {
+	return strings.Contains(flags, "E") && (strings.Contains(flags, "A") || strings.Contains(flags, "x"))
+}
+
+// IndexBackfill adds the backfill to the index, including its numeric search
+// fields, tags, and create time, so QueryIndexedBackfills can filter
+// server-side instead of the caller fetching and filtering the full index.
+func (rb *redisBackend) IndexBackfill(ctx context.Context, backfill *pb.Backfill) error {
+	err := rb.rdb.HSet(ctx, allBackfills, backfill.Id, backfill.Generation).Err()
 	if err != nil {
 		err = errors.Wrapf(err, "failed to add backfill to all backfills, id: %s", backfill.Id)
 		return status.Errorf(codes.Internal, "%v", err)
 	}
 
+	return rb.indexBackfillAttributes(ctx, backfill)
+}
+
+// indexBackfillAttributes stores the backfill's double search fields and
+// tags in per-field sorted sets/sets, and records which of those keys it
+// landed in so DeindexBackfill can later remove it again.
+func (rb *redisBackend) indexBackfillAttributes(ctx context.Context, backfill *pb.Backfill) error {
+	fields := backfill.GetSearchFields()
+	indexedKeys := make([]interface{}, 0, len(fields.GetDoubleArgs())+len(fields.GetTags())+1)
+
+	pipe := rb.rdb.Pipeline()
+	for attr, value := range fields.GetDoubleArgs() {
+		key := backfillAttrKey(attr)
+		pipe.ZAdd(ctx, key, redis.Z{Score: value, Member: backfill.Id})
+		indexedKeys = append(indexedKeys, key)
+	}
+	for _, tag := range fields.GetTags() {
+		key := backfillTagKey(tag)
+		pipe.SAdd(ctx, key, backfill.Id)
+		indexedKeys = append(indexedKeys, key)
+	}
+
+	if createTime := backfill.GetCreateTime(); createTime != nil {
+		t, err := ptypes.Timestamp(createTime)
+		if err != nil {
+			return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to parse create time for backfill, id: %s", backfill.Id))
+		}
+		pipe.ZAdd(ctx, backfillCreateTime, redis.Z{Score: float64(t.UnixNano()), Member: backfill.Id})
+		indexedKeys = append(indexedKeys, backfillCreateTime)
+	}
+
+	if len(indexedKeys) > 0 {
+		pipe.SAdd(ctx, backfillIndexedFieldsKey(backfill.Id), indexedKeys...)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to index backfill search fields, id: %s", backfill.Id))
+	}
+
 	return nil
 }
 
 // DeindexBackfill removes specified Backfill ID from the index. The Backfill continues to exist.
 func (rb *redisBackend) DeindexBackfill(ctx context.Context, id string) error {
-	redisConn, err := rb.redisPool.GetContext(ctx)
+	err := rb.rdb.HDel(ctx, allBackfills, id).Err()
 	if err != nil {
-		return status.Errorf(codes.Unavailable, "DeindexBackfill, id: %s, failed to connect to redis: %v", id, err)
+		err = errors.Wrapf(err, "failed to remove ID from backfill index, id: %s", id)
+		return status.Errorf(codes.Internal, "%v", err)
 	}
-	defer handleConnectionClose(&redisConn)
 
-	err = redisConn.Send("HDEL", allBackfills, id)
+	return rb.deindexBackfillAttributes(ctx, id)
+}
+
+// deindexBackfillAttributes removes id from every attribute/tag key it was
+// indexed under and forgets that bookkeeping set.
+func (rb *redisBackend) deindexBackfillAttributes(ctx context.Context, id string) error {
+	fieldsKey := backfillIndexedFieldsKey(id)
+	indexedKeys, err := rb.rdb.SMembers(ctx, fieldsKey).Result()
 	if err != nil {
-		err = errors.Wrapf(err, "failed to remove ID from backfill index, id: %s", id)
-		return status.Errorf(codes.Internal, "%v", err)
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to read indexed fields for backfill, id: %s", id))
+	}
+
+	if len(indexedKeys) == 0 {
+		return nil
+	}
+
+	pipe := rb.rdb.Pipeline()
+	for _, key := range indexedKeys {
+		if strings.HasPrefix(key, backfillTagKeyPrefix) {
+			pipe.SRem(ctx, key, id)
+		} else {
+			pipe.ZRem(ctx, key, id)
+		}
+	}
+	pipe.Del(ctx, fieldsKey)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to deindex backfill attributes, id: %s", id))
 	}
 
 	return nil
@@ -237,13 +440,7 @@ func (rb *redisBackend) DeindexBackfill(ctx context.Context, id string) error {
 
 // GetIndexedBackfills returns the ids of all backfills currently indexed.
 func (rb *redisBackend) GetIndexedBackfills(ctx context.Context) (map[string]int, error) {
-	redisConn, err := rb.redisPool.GetContext(ctx)
-	if err != nil {
-		return nil, status.Errorf(codes.Unavailable, "GetIndexedBackfills, failed to connect to redis: %v", err)
-	}
-	defer handleConnectionClose(&redisConn)
-
-	bfIndex, err := redis.StringMap(redisConn.Do("HGETALL", allBackfills))
+	bfIndex, err := rb.rdb.HGetAll(ctx, allBackfills).Result()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "error getting all indexed backfill ids %v", err)
 	}
@@ -259,3 +456,108 @@ func (rb *redisBackend) GetIndexedBackfills(ctx context.Context) (map[string]int
 
 	return r, nil
 }
+
+// QueryIndexedBackfills returns the ids and generations of indexed backfills
+// that satisfy every filter in pool. It is the fallback emulation of a
+// RediSearch-style secondary index: each filter narrows the candidate set
+// with one ZRANGEBYSCORE/SINTER round trip, and the remaining intersection
+// happens in process, since Sorted Set ranges and Set tag membership can't
+// be combined into a single Redis command.
+func (rb *redisBackend) QueryIndexedBackfills(ctx context.Context, pool *pb.Pool) (map[string]int, error) {
+	var candidateIDs map[string]struct{}
+	matched := false
+
+	intersect := func(ids []string) {
+		next := make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			if matched {
+				if _, ok := candidateIDs[id]; !ok {
+					continue
+				}
+			}
+			next[id] = struct{}{}
+		}
+		candidateIDs = next
+		matched = true
+	}
+
+	for _, rf := range pool.GetDoubleRangeFilters() {
+		ids, err := rb.rdb.ZRangeByScore(ctx, backfillAttrKey(rf.GetDoubleArg()), &redis.ZRangeBy{
+			Min: strconv.FormatFloat(rf.GetMin(), 'f', -1, 64),
+			Max: strconv.FormatFloat(rf.GetMax(), 'f', -1, 64),
+		}).Result()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to query backfill attribute %s", rf.GetDoubleArg()))
+		}
+		intersect(ids)
+	}
+
+	if tagFilters := pool.GetTagPresentFilters(); len(tagFilters) > 0 {
+		tagKeys := make([]string, 0, len(tagFilters))
+		for _, tf := range tagFilters {
+			tagKeys = append(tagKeys, backfillTagKey(tf.GetTag()))
+		}
+		ids, err := rb.rdb.SInter(ctx, tagKeys...).Result()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", errors.Wrap(err, "failed to query backfill tags"))
+		}
+		intersect(ids)
+	}
+
+	if before, after := pool.GetCreatedBefore(), pool.GetCreatedAfter(); before != nil || after != nil {
+		min, max := "-inf", "+inf"
+		if after != nil {
+			t, err := ptypes.Timestamp(after)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "%v", errors.Wrap(err, "failed to parse created_after filter"))
+			}
+			min = strconv.FormatInt(t.UnixNano(), 10)
+		}
+		if before != nil {
+			t, err := ptypes.Timestamp(before)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "%v", errors.Wrap(err, "failed to parse created_before filter"))
+			}
+			max = strconv.FormatInt(t.UnixNano(), 10)
+		}
+		ids, err := rb.rdb.ZRangeByScore(ctx, backfillCreateTime, &redis.ZRangeBy{Min: min, Max: max}).Result()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "%v", errors.Wrap(err, "failed to query backfill create time"))
+		}
+		intersect(ids)
+	}
+
+	if !matched {
+		// No filters were supplied: behave like GetIndexedBackfills.
+		return rb.GetIndexedBackfills(ctx)
+	}
+
+	if len(candidateIDs) == 0 {
+		return map[string]int{}, nil
+	}
+
+	ids := make([]string, 0, len(candidateIDs))
+	for id := range candidateIDs {
+		ids = append(ids, id)
+	}
+
+	generations, err := rb.rdb.HMGet(ctx, allBackfills, ids...).Result()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", errors.Wrap(err, "failed to read generations for matched backfills"))
+	}
+
+	r := make(map[string]int, len(ids))
+	for i, raw := range generations {
+		gen, ok := raw.(string)
+		if !ok {
+			continue
+		}
+		g, err := strconv.Atoi(gen)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "error while parsing generation into number: %v", err)
+		}
+		r[ids[i]] = g
+	}
+
+	return r, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasExpiredKeyspaceEvents(t *testing.T) {
+	cases := []struct {
+		name  string
+		flags string
+		want  bool
+	}{
+		{"empty", "", false},
+		{"Ex in order", "Ex", true},
+		{"xE reversed order", "xE", true},
+		{"EA all classes", "EA", true},
+		{"AE reversed order", "AE", true},
+		{"KEA with other classes", "KEA", true},
+		{"expired class without keyevent", "gx", false},
+		{"keyevent without expired class", "gE", false},
+		{"expired class with keyspace but no keyevent", "gxK", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, hasExpiredKeyspaceEvents(c.flags))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v3"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+
+	"open-match.dev/open-match/pkg/pb"
+)
+
+func newTestRedisBackend(t *testing.T) *redisBackend {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return &redisBackend{rdb: rdb, cfg: nil}
+}
+
+func mustIndex(t *testing.T, rb *redisBackend, backfill *pb.Backfill) {
+	t.Helper()
+	require.NoError(t, rb.IndexBackfill(context.Background(), backfill))
+}
+
+// TestQueryIndexedBackfillsFiltering covers the double-range, tag, and
+// create-time filters QueryIndexedBackfills emulates with Sorted Sets and
+// Sets, including that multiple filters intersect rather than union.
+func TestQueryIndexedBackfillsFiltering(t *testing.T) {
+	ctx := context.Background()
+	rb := newTestRedisBackend(t)
+
+	a := &pb.Backfill{Id: "a", Generation: 1, SearchFields: &pb.SearchFields{
+		DoubleArgs: map[string]float64{"open_slots": 2}, Tags: []string{"ranked"},
+	}}
+	b := &pb.Backfill{Id: "b", Generation: 1, SearchFields: &pb.SearchFields{
+		DoubleArgs: map[string]float64{"open_slots": 8}, Tags: []string{"ranked"},
+	}}
+	c := &pb.Backfill{Id: "c", Generation: 1, SearchFields: &pb.SearchFields{
+		DoubleArgs: map[string]float64{"open_slots": 2}, Tags: []string{"casual"},
+	}}
+
+	mustIndex(t, rb, a)
+	mustIndex(t, rb, b)
+	mustIndex(t, rb, c)
+
+	t.Run("no filters returns everything indexed", func(t *testing.T) {
+		got, err := rb.QueryIndexedBackfills(ctx, &pb.Pool{})
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+	})
+
+	t.Run("double range filter", func(t *testing.T) {
+		got, err := rb.QueryIndexedBackfills(ctx, &pb.Pool{
+			DoubleRangeFilters: []*pb.DoubleRangeFilter{{DoubleArg: "open_slots", Min: 0, Max: 5}},
+		})
+		require.NoError(t, err)
+		require.Contains(t, got, "a")
+		require.Contains(t, got, "c")
+		require.NotContains(t, got, "b")
+	})
+
+	t.Run("tag filter", func(t *testing.T) {
+		got, err := rb.QueryIndexedBackfills(ctx, &pb.Pool{
+			TagPresentFilters: []*pb.TagPresentFilter{{Tag: "ranked"}},
+		})
+		require.NoError(t, err)
+		require.Contains(t, got, "a")
+		require.Contains(t, got, "b")
+		require.NotContains(t, got, "c")
+	})
+
+	t.Run("double range and tag filters intersect", func(t *testing.T) {
+		got, err := rb.QueryIndexedBackfills(ctx, &pb.Pool{
+			DoubleRangeFilters: []*pb.DoubleRangeFilter{{DoubleArg: "open_slots", Min: 0, Max: 5}},
+			TagPresentFilters:  []*pb.TagPresentFilter{{Tag: "ranked"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{"a": 1}, got)
+	})
+
+	t.Run("empty match returns an empty, non-nil map", func(t *testing.T) {
+		got, err := rb.QueryIndexedBackfills(ctx, &pb.Pool{
+			TagPresentFilters: []*pb.TagPresentFilter{{Tag: "no-such-tag"}},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		require.Empty(t, got)
+	})
+}
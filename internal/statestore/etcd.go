@@ -0,0 +1,301 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"open-match.dev/open-match/internal/config"
+	"open-match.dev/open-match/internal/ipb"
+	"open-match.dev/open-match/pkg/pb"
+)
+
+// etcdBackend is the etcd v3 based alternative to redisBackend, selected via
+// the backend.type: etcd config key. It stores each Backfill under its own
+// key and gives each acknowledgement key an etcd lease, so etcd deletes the
+// key once the acknowledgement window passes. Expired backfills are not
+// reported: GetExpiredBackfillIDs and WatchExpiredBackfills never return
+// any ids. Like redisBackend, creating a backfill does
+// not index it: IndexBackfill is always a separate, explicit call, so the
+// two backends agree on when a backfill becomes visible to
+// QueryIndexedBackfills. As with redisBackend, only the Backfill surface of
+// Service is implemented here; Ticket/Assignment storage is out of scope for
+// this backend.
+type etcdBackend struct {
+	client *clientv3.Client
+	cfg    config.View
+}
+
+func newEtcdBackend(cfg config.View) (Service, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.GetStringSlice("etcd.endpoints"),
+		DialTimeout: cfg.GetDuration("etcd.dialTimeout"),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create etcd client")
+	}
+
+	return &etcdBackend{client: client, cfg: cfg}, nil
+}
+
+func (eb *etcdBackend) Close() error {
+	return eb.client.Close()
+}
+
+func (eb *etcdBackend) HealthCheck(ctx context.Context) error {
+	if len(eb.client.Endpoints()) == 0 {
+		return status.Error(codes.Unavailable, "etcd health check failed: no endpoints configured")
+	}
+	if _, err := eb.client.Status(ctx, eb.client.Endpoints()[0]); err != nil {
+		return status.Errorf(codes.Unavailable, "etcd health check failed: %v", err)
+	}
+	return nil
+}
+
+func backfillIndexPrefix() string     { return "/backfills/index/" }
+func backfillKey(id string) string    { return "/backfills/data/" + id }
+func backfillAckKey(id string) string { return "/backfills/ack/" + id }
+
+// CreateBackfill creates a new Backfill in etcd if one doesn't exist yet,
+// using a Txn guarded on the key's create revision being zero. This is
+// etcd's equivalent of the existence check redisBackend's CreateBackfill
+// Lua script performs for the same purpose.
+func (eb *etcdBackend) CreateBackfill(ctx context.Context, backfill *pb.Backfill, ticketIDs []string) error {
+	bf := ipb.BackfillInternal{Backfill: backfill, TicketIds: ticketIDs}
+	value, err := proto.Marshal(&bf)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to marshal the backfill proto, id: %s", backfill.GetId()))
+	}
+
+	key := backfillKey(backfill.GetId())
+	resp, err := eb.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(value))).
+		Commit()
+	if err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to create backfill, id: %s", backfill.GetId()))
+	}
+	if !resp.Succeeded {
+		return status.Errorf(codes.AlreadyExists, "backfill already exists, id: %s", backfill.GetId())
+	}
+
+	return eb.AcknowledgeBackfill(ctx, backfill.GetId())
+}
+
+// GetBackfill gets the Backfill with the specified id from state storage. This method fails if the Backfill does not exist.
+func (eb *etcdBackend) GetBackfill(ctx context.Context, id string) (*pb.Backfill, []string, error) {
+	resp, err := eb.client.Get(ctx, backfillKey(id))
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to get the backfill from etcd, id: %s", id))
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil, status.Errorf(codes.NotFound, "Backfill id: %s not found", id)
+	}
+
+	bi := &ipb.BackfillInternal{}
+	if err := proto.Unmarshal(resp.Kvs[0].Value, bi); err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to unmarshal internal backfill, id: %s", id))
+	}
+
+	return bi.Backfill, bi.TicketIds, nil
+}
+
+// DeleteBackfill removes the Backfill with the specified id from state storage. This method succeeds if the Backfill does not exist.
+func (eb *etcdBackend) DeleteBackfill(ctx context.Context, id string) error {
+	if _, err := eb.client.Delete(ctx, backfillKey(id)); err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to delete the backfill from etcd, id: %s", id))
+	}
+	if _, err := eb.client.Delete(ctx, backfillAckKey(id)); err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to delete backfill ack lease, id: %s", id))
+	}
+	return nil
+}
+
+// UpdateBackfill updates an existing Backfill with a new data. ticketIDs can be nil.
+func (eb *etcdBackend) UpdateBackfill(ctx context.Context, backfill *pb.Backfill, ticketIDs []string) error {
+	bf := ipb.BackfillInternal{Backfill: backfill, TicketIds: ticketIDs}
+	value, err := proto.Marshal(&bf)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to marshal the backfill proto, id: %s", backfill.GetId()))
+	}
+
+	if _, err := eb.client.Put(ctx, backfillKey(backfill.GetId()), string(value)); err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to update the backfill in etcd, id: %s", backfill.GetId()))
+	}
+	return nil
+}
+
+// AcknowledgeBackfill grants the backfill's ack key a fresh lease scoped to
+// 80% of pendingReleaseTimeout, mirroring the fraction redisBackend applies
+// in GetExpiredBackfillIDs. The lease TTL is rounded up to a whole second,
+// since etcd leases only have second granularity and truncating a
+// sub-second remainder would let the ack key expire before the window
+// redisBackend uses for the same backfill actually elapses.
+func (eb *etcdBackend) AcknowledgeBackfill(ctx context.Context, id string) error {
+	ttl := eb.cfg.GetDuration("pendingReleaseTimeout") / 5 * 4
+	ttlSeconds := int64((ttl + time.Second - 1) / time.Second)
+	if ttlSeconds < 1 {
+		ttlSeconds = 1
+	}
+	lease, err := eb.client.Grant(ctx, ttlSeconds)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrap(err, "failed to grant backfill ack lease"))
+	}
+
+	if _, err := eb.client.Put(ctx, backfillAckKey(id), id, clientv3.WithLease(lease.ID)); err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrap(err, "failed to store backfill's last acknowledgement time"))
+	}
+	return nil
+}
+
+// GetExpiredBackfillIDs always returns an empty list. Ack keys are removed
+// by etcd once their lease runs out, but the backfill data stays, and this
+// method does not look for backfills whose ack key is gone.
+func (eb *etcdBackend) GetExpiredBackfillIDs(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+// WatchExpiredBackfills returns a channel that is closed immediately, so no
+// expired backfill id is ever delivered; the deletion of an ack key by its
+// lease is not watched.
+func (eb *etcdBackend) WatchExpiredBackfills(ctx context.Context) <-chan string {
+	out := make(chan string)
+	close(out)
+	return out
+}
+
+// IndexBackfill adds the backfill to the index.
+func (eb *etcdBackend) IndexBackfill(ctx context.Context, backfill *pb.Backfill) error {
+	if _, err := eb.client.Put(ctx, backfillIndexPrefix()+backfill.Id, strconv.Itoa(int(backfill.Generation))); err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to add backfill to index, id: %s", backfill.Id))
+	}
+	return nil
+}
+
+// DeindexBackfill removes specified Backfill ID from the index. The Backfill continues to exist.
+func (eb *etcdBackend) DeindexBackfill(ctx context.Context, id string) error {
+	if _, err := eb.client.Delete(ctx, backfillIndexPrefix()+id); err != nil {
+		return status.Errorf(codes.Internal, "%v", errors.Wrapf(err, "failed to remove ID from backfill index, id: %s", id))
+	}
+	return nil
+}
+
+// GetIndexedBackfills returns the ids of all backfills currently indexed.
+func (eb *etcdBackend) GetIndexedBackfills(ctx context.Context) (map[string]int, error) {
+	resp, err := eb.client.Get(ctx, backfillIndexPrefix(), clientv3.WithPrefix())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error getting all indexed backfill ids %v", err)
+	}
+
+	r := make(map[string]int, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		id := strings.TrimPrefix(string(kv.Key), backfillIndexPrefix())
+		gen, err := strconv.Atoi(string(kv.Value))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "error while parsing generation into number: %v", err)
+		}
+		r[id] = gen
+	}
+	return r, nil
+}
+
+// QueryIndexedBackfills emulates the server-side filtering redisBackend does
+// with Sorted Sets and Sets by fetching the full index and applying pool's
+// filters in process; etcd has no equivalent numeric-range or
+// set-membership primitive to push that work into the store itself.
+func (eb *etcdBackend) QueryIndexedBackfills(ctx context.Context, pool *pb.Pool) (map[string]int, error) {
+	all, err := eb.GetIndexedBackfills(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pool.GetDoubleRangeFilters()) == 0 && len(pool.GetTagPresentFilters()) == 0 &&
+		pool.GetCreatedBefore() == nil && pool.GetCreatedAfter() == nil {
+		return all, nil
+	}
+
+	r := make(map[string]int, len(all))
+	for id, gen := range all {
+		backfill, _, err := eb.GetBackfill(ctx, id)
+		if err != nil {
+			continue
+		}
+		if matchesPool(backfill, pool) {
+			r[id] = gen
+		}
+	}
+	return r, nil
+}
+
+// matchesPool reports whether backfill's search fields satisfy every filter in pool.
+func matchesPool(backfill *pb.Backfill, pool *pb.Pool) bool {
+	fields := backfill.GetSearchFields()
+
+	for _, rf := range pool.GetDoubleRangeFilters() {
+		v, ok := fields.GetDoubleArgs()[rf.GetDoubleArg()]
+		if !ok || v < rf.GetMin() || v > rf.GetMax() {
+			return false
+		}
+	}
+
+	for _, tf := range pool.GetTagPresentFilters() {
+		present := false
+		for _, tag := range fields.GetTags() {
+			if tag == tf.GetTag() {
+				present = true
+				break
+			}
+		}
+		if !present {
+			return false
+		}
+	}
+
+	createTime := backfill.GetCreateTime()
+	if after := pool.GetCreatedAfter(); after != nil {
+		// redisBackend excludes these: a backfill is only scored into
+		// backfillCreateTime once it has a create time, so one without
+		// never matches a ZRANGEBYSCORE create-time filter either.
+		if createTime == nil {
+			return false
+		}
+		t, _ := ptypes.Timestamp(createTime)
+		a, _ := ptypes.Timestamp(after)
+		if t.Before(a) {
+			return false
+		}
+	}
+	if before := pool.GetCreatedBefore(); before != nil {
+		if createTime == nil {
+			return false
+		}
+		t, _ := ptypes.Timestamp(createTime)
+		b, _ := ptypes.Timestamp(before)
+		if t.After(b) {
+			return false
+		}
+	}
+
+	return true
+}
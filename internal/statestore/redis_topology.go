@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+
+	"open-match.dev/open-match/internal/config"
+	"open-match.dev/open-match/internal/statestore/scripts"
+)
+
+// redisTopology identifies which Redis deployment shape the backend should
+// dial into. Exactly one of sentinel or cluster mode is active at a time;
+// the zero value is the pre-existing single master/replica topology.
+type redisTopology int
+
+const (
+	redisTopologySingle redisTopology = iota
+	redisTopologySentinel
+	redisTopologyCluster
+)
+
+// topologyFromConfig inspects the redis.* config keys and determines which
+// topology the caller asked for. Sentinel and Cluster addresses are mutually
+// exclusive; specifying both is a configuration error.
+func topologyFromConfig(cfg config.View) (redisTopology, error) {
+	hasSentinel := cfg.IsSet("redis.sentinelAddrs") && len(cfg.GetStringSlice("redis.sentinelAddrs")) > 0
+	hasCluster := cfg.IsSet("redis.clusterAddrs") && len(cfg.GetStringSlice("redis.clusterAddrs")) > 0
+
+	switch {
+	case hasSentinel && hasCluster:
+		return redisTopologySingle, errors.New("redis.sentinelAddrs and redis.clusterAddrs are mutually exclusive")
+	case hasSentinel:
+		return redisTopologySentinel, nil
+	case hasCluster:
+		return redisTopologyCluster, nil
+	default:
+		return redisTopologySingle, nil
+	}
+}
+
+// newUniversalClient builds the go-redis client matching the topology
+// described by cfg and loads the scripts package's Lua scripts into it.
+// go-redis's UniversalClient already knows how to rediscover the current
+// master through Sentinel and how to route commands to the right Cluster
+// shard via CRC16 slot mapping, so CreateBackfill, GetBackfill,
+// IndexBackfill, AcknowledgeBackfill, etc. keep working unchanged regardless
+// of which concrete client type is returned.
+func newUniversalClient(ctx context.Context, cfg config.View) (redis.UniversalClient, error) {
+	rdb, err := dialUniversalClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := scripts.Load(ctx, rdb); err != nil {
+		return nil, errors.Wrap(err, "failed to load statestore lua scripts")
+	}
+
+	return rdb, nil
+}
+
+// dialUniversalClient builds the go-redis client for the topology described
+// by cfg, without loading any scripts into it.
+func dialUniversalClient(cfg config.View) (redis.UniversalClient, error) {
+	topology, err := topologyFromConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to determine redis topology from config")
+	}
+
+	password := cfg.GetString("redis.password")
+	poolSize := cfg.GetInt("redis.pool.maxActive")
+	db := cfg.GetInt("redis.db")
+
+	switch topology {
+	case redisTopologySentinel:
+		masterName := cfg.GetString("redis.sentinelMaster")
+		if masterName == "" {
+			return nil, errors.New("redis.sentinelMaster must be set when redis.sentinelAddrs is configured")
+		}
+
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    masterName,
+			SentinelAddrs: cfg.GetStringSlice("redis.sentinelAddrs"),
+			Password:      password,
+			DB:            db,
+			PoolSize:      poolSize,
+		}), nil
+
+	case redisTopologyCluster:
+		addrs := cfg.GetStringSlice("redis.clusterAddrs")
+		if len(addrs) == 0 {
+			return nil, errors.New("redis.clusterAddrs must not be empty for cluster topology")
+		}
+
+		// Redis Cluster has no SELECT; every key lives in logical DB 0, so
+		// there is no DB field to set here. keyspaceEventDB below reports 0
+		// for this topology regardless of what redis.db is set to.
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    addrs,
+			Password: password,
+			PoolSize: poolSize,
+		}), nil
+
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:     cfg.GetString("redis.hostname") + ":" + cfg.GetString("redis.port"),
+			Password: password,
+			DB:       db,
+			PoolSize: poolSize,
+		}), nil
+	}
+}
+
+// keyspaceEventDB returns the logical DB index whose keyspace notifications
+// WatchExpiredBackfills should subscribe to: redis.db for the single and
+// Sentinel topologies, or always 0 for Cluster, which has no concept of
+// multiple logical databases.
+func keyspaceEventDB(cfg config.View) int {
+	topology, err := topologyFromConfig(cfg)
+	if err != nil || topology == redisTopologyCluster {
+		return 0
+	}
+	return cfg.GetInt("redis.db")
+}
+
+// clusterKeyTag wraps a key with the shared `{om}` hash tag so that all
+// Open Match keys which must be read or written together in a single
+// command or Lua script (allBackfills, backfillLastAckTime, and the
+// per-backfill keys built from backfillDataKey/backfillExpiryKey/
+// backfillIndexedFieldsKey) are always routed to the same cluster slot.
+func clusterKeyTag(key string) string {
+	return "{om}" + key
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopologyFromConfig(t *testing.T) {
+	cases := []struct {
+		name    string
+		set     map[string]interface{}
+		want    redisTopology
+		wantErr bool
+	}{
+		{"default", nil, redisTopologySingle, false},
+		{
+			"sentinel",
+			map[string]interface{}{"redis.sentinelAddrs": []string{"sentinel:26379"}},
+			redisTopologySentinel, false,
+		},
+		{
+			"cluster",
+			map[string]interface{}{"redis.clusterAddrs": []string{"redis-0:6379", "redis-1:6379"}},
+			redisTopologyCluster, false,
+		},
+		{
+			"both set is an error",
+			map[string]interface{}{
+				"redis.sentinelAddrs": []string{"sentinel:26379"},
+				"redis.clusterAddrs":  []string{"redis-0:6379"},
+			},
+			redisTopologySingle, true,
+		},
+		{
+			"empty slices fall back to single",
+			map[string]interface{}{
+				"redis.sentinelAddrs": []string{},
+				"redis.clusterAddrs":  []string{},
+			},
+			redisTopologySingle, false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := viper.New()
+			for key, value := range c.set {
+				v.Set(key, value)
+			}
+
+			got, err := topologyFromConfig(v)
+			if c.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestClusterKeyTag(t *testing.T) {
+	assert.Equal(t, "{om}allBackfills", clusterKeyTag("allBackfills"))
+	assert.Equal(t, "{om}backfill:abc123", clusterKeyTag("backfill:abc123"))
+}
+
+func TestKeyspaceEventDB(t *testing.T) {
+	t.Run("single topology uses redis.db", func(t *testing.T) {
+		v := viper.New()
+		v.Set("redis.db", 3)
+		assert.Equal(t, 3, keyspaceEventDB(v))
+	})
+
+	t.Run("sentinel topology uses redis.db", func(t *testing.T) {
+		v := viper.New()
+		v.Set("redis.sentinelAddrs", []string{"sentinel:26379"})
+		v.Set("redis.sentinelMaster", "mymaster")
+		v.Set("redis.db", 2)
+		assert.Equal(t, 2, keyspaceEventDB(v))
+	})
+
+	t.Run("cluster topology is always DB 0", func(t *testing.T) {
+		v := viper.New()
+		v.Set("redis.clusterAddrs", []string{"redis-0:6379"})
+		v.Set("redis.db", 2)
+		assert.Equal(t, 0, keyspaceEventDB(v))
+	})
+
+	t.Run("default is DB 0", func(t *testing.T) {
+		assert.Equal(t, 0, keyspaceEventDB(viper.New()))
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scripts loads and runs the Lua scripts that let redisBackend
+// perform its multi-key Backfill operations (create+acknowledge,
+// delete+unacknowledge, update+index generation refresh) as a single atomic
+// round trip, instead of
+// as several separate commands that can leave state inconsistent if one of
+// them fails partway through.
+package scripts
+
+import (
+	"context"
+	_ "embed"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/pkg/errors"
+)
+
+//go:embed create_backfill.lua
+var createBackfillSource string
+
+//go:embed delete_backfill.lua
+var deleteBackfillSource string
+
+//go:embed update_backfill.lua
+var updateBackfillSource string
+
+// Script wraps a Lua script that has been (or will be) loaded into Redis
+// with SCRIPT LOAD. Script values are package-level singletons shared by
+// every concurrent backend call, so sha is an atomic.Value rather than a
+// plain string: Run reads it on every call while Load and Run's own
+// NOSCRIPT fallback both write it.
+type Script struct {
+	source string
+	sha    atomic.Value // string
+}
+
+// The scripts redisBackend runs for its Backfill write paths. See the
+// matching .lua file in this package for the KEYS/ARGV contract each one
+// expects.
+var (
+	CreateBackfill = &Script{source: createBackfillSource}
+	DeleteBackfill = &Script{source: deleteBackfillSource}
+	UpdateBackfill = &Script{source: updateBackfillSource}
+)
+
+// All is every script that must be loaded at backend init.
+var All = []*Script{CreateBackfill, DeleteBackfill, UpdateBackfill}
+
+// Load runs SCRIPT LOAD for every script in All and caches the resulting
+// SHA1 digests so Run can use EVALSHA instead of shipping the full source
+// on every call.
+func Load(ctx context.Context, rdb redis.UniversalClient) error {
+	for _, s := range All {
+		sha, err := rdb.ScriptLoad(ctx, s.source).Result()
+		if err != nil {
+			return errors.Wrap(err, "failed to load script into redis")
+		}
+		s.sha.Store(sha)
+	}
+	return nil
+}
+
+// Run executes the script via EVALSHA using the cached digest, falling back
+// to a full EVAL (and re-caching the digest) if Redis reports NOSCRIPT, e.g.
+// because the server restarted and lost its script cache.
+func (s *Script) Run(ctx context.Context, rdb redis.UniversalClient, keys []string, args ...interface{}) (interface{}, error) {
+	if sha, ok := s.sha.Load().(string); ok && sha != "" {
+		res, err := rdb.EvalSha(ctx, sha, keys, args...).Result()
+		if err == nil || !isNoScript(err) {
+			return res, err
+		}
+	}
+
+	res, err := rdb.Eval(ctx, s.source, keys, args...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if sha, shaErr := rdb.ScriptLoad(ctx, s.source).Result(); shaErr == nil {
+		s.sha.Store(sha)
+	}
+
+	return res, nil
+}
+
+func isNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
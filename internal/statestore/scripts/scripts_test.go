@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scripts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v3"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) redis.UniversalClient {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func TestCreateBackfillIsAtomicAndRejectsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestClient(t)
+	require.NoError(t, Load(ctx, rdb))
+
+	keys := []string{"{om}backfill:id1", "{om}backfill_last_ack_time", "{om}backfill:ack:id1"}
+
+	res, err := CreateBackfill.Run(ctx, rdb, keys, "payload", 1000, 60000, "id1")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, res)
+
+	require.Equal(t, "payload", rdb.Get(ctx, "{om}backfill:id1").Val())
+	require.EqualValues(t, 1, rdb.Exists(ctx, "{om}backfill:ack:id1").Val())
+	score, err := rdb.ZScore(ctx, "{om}backfill_last_ack_time", "id1").Result()
+	require.NoError(t, err)
+	require.EqualValues(t, 1000, score)
+
+	res, err = CreateBackfill.Run(ctx, rdb, keys, "other-payload", 2000, 60000, "id1")
+	require.NoError(t, err)
+	require.EqualValues(t, 0, res, "re-creating the same id must not overwrite it")
+	require.Equal(t, "payload", rdb.Get(ctx, "{om}backfill:id1").Val())
+}
+
+func TestUpdateBackfillDoesNotIndexAnUnindexedBackfill(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestClient(t)
+	require.NoError(t, Load(ctx, rdb))
+
+	keys := []string{"{om}backfill:id1", "{om}allBackfills"}
+
+	res, err := UpdateBackfill.Run(ctx, rdb, keys, "payload-v1", "id1", 1)
+	require.NoError(t, err)
+	require.EqualValues(t, -1, res, "no previous generation was indexed yet")
+	require.Equal(t, "payload-v1", rdb.Get(ctx, "{om}backfill:id1").Val())
+	require.False(t, rdb.HExists(ctx, "{om}allBackfills", "id1").Val(),
+		"updating a never-indexed backfill must not index it")
+}
+
+func TestUpdateBackfillRefreshesAnAlreadyIndexedBackfill(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestClient(t)
+	require.NoError(t, Load(ctx, rdb))
+
+	keys := []string{"{om}backfill:id1", "{om}allBackfills"}
+	require.NoError(t, rdb.HSet(ctx, "{om}allBackfills", "id1", 1).Err())
+
+	res, err := UpdateBackfill.Run(ctx, rdb, keys, "payload-v2", "id1", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, res, "previous generation of an indexed backfill")
+	require.Equal(t, "payload-v2", rdb.Get(ctx, "{om}backfill:id1").Val())
+	require.Equal(t, "2", rdb.HGet(ctx, "{om}allBackfills", "id1").Val())
+}
+
+func TestDeleteBackfillRemovesDataAndAckButLeavesIndexAlone(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestClient(t)
+	require.NoError(t, Load(ctx, rdb))
+
+	createKeys := []string{"{om}backfill:id1", "{om}backfill_last_ack_time", "{om}backfill:ack:id1"}
+	_, err := CreateBackfill.Run(ctx, rdb, createKeys, "payload", 1000, 60000, "id1")
+	require.NoError(t, err)
+	require.NoError(t, rdb.HSet(ctx, "{om}allBackfills", "id1", 1).Err())
+
+	deleteKeys := []string{"{om}backfill:id1", "{om}backfill_last_ack_time", "{om}backfill:ack:id1"}
+	res, err := DeleteBackfill.Run(ctx, rdb, deleteKeys, "id1")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, res)
+
+	require.EqualValues(t, 0, rdb.Exists(ctx, "{om}backfill:id1").Val())
+	require.EqualValues(t, 0, rdb.Exists(ctx, "{om}backfill:ack:id1").Val())
+	_, err = rdb.ZScore(ctx, "{om}backfill_last_ack_time", "id1").Result()
+	require.ErrorIs(t, err, redis.Nil)
+	require.True(t, rdb.HExists(ctx, "{om}allBackfills", "id1").Val(),
+		"delete must not touch the index; that is DeindexBackfill's job")
+
+	res, err = DeleteBackfill.Run(ctx, rdb, deleteKeys, "id1")
+	require.NoError(t, err, "deleting an already-deleted id is not an error")
+	require.EqualValues(t, 1, res)
+}
+
+// TestRunFallsBackToEvalOnNoScript simulates a server that lost its script
+// cache (e.g. after a restart) by clearing it out from under an already
+// -loaded Script, and checks Run recovers via EVAL instead of surfacing
+// NOSCRIPT to the caller.
+func TestRunFallsBackToEvalOnNoScript(t *testing.T) {
+	ctx := context.Background()
+	rdb := newTestClient(t)
+	require.NoError(t, Load(ctx, rdb))
+
+	require.NoError(t, rdb.ScriptFlush(ctx).Err())
+
+	keys := []string{"{om}backfill:id1", "{om}backfill_last_ack_time", "{om}backfill:ack:id1"}
+	res, err := CreateBackfill.Run(ctx, rdb, keys, "payload", 1000, 60000, "id1")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, res)
+
+	// The fallback re-caches the sha, so it should now exist in the script
+	// cache again without needing another ScriptFlush-triggered fallback.
+	sha, _ := CreateBackfill.sha.Load().(string)
+	exists, err := rdb.ScriptExists(ctx, sha).Result()
+	require.NoError(t, err)
+	require.Equal(t, []bool{true}, exists)
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"open-match.dev/open-match/internal/config"
+	"open-match.dev/open-match/pkg/pb"
+)
+
+// Service is the seam between the matchmaking function, evaluator, and
+// backend/frontend services and whatever is actually holding Backfill state.
+// redisBackend is the original implementation; etcdBackend is an alternative
+// for deployments that already run etcd and would rather not operate Redis.
+// Only the Backfill surface is restated here, since that is what this
+// package currently exposes; the remaining Ticket/Assignment methods Service
+// must also satisfy live alongside their own backend code.
+type Service interface {
+	CreateBackfill(ctx context.Context, backfill *pb.Backfill, ticketIDs []string) error
+	GetBackfill(ctx context.Context, id string) (*pb.Backfill, []string, error)
+	DeleteBackfill(ctx context.Context, id string) error
+	UpdateBackfill(ctx context.Context, backfill *pb.Backfill, ticketIDs []string) error
+	AcknowledgeBackfill(ctx context.Context, id string) error
+	GetExpiredBackfillIDs(ctx context.Context) ([]string, error)
+	WatchExpiredBackfills(ctx context.Context) <-chan string
+	IndexBackfill(ctx context.Context, backfill *pb.Backfill) error
+	DeindexBackfill(ctx context.Context, id string) error
+	GetIndexedBackfills(ctx context.Context) (map[string]int, error)
+	QueryIndexedBackfills(ctx context.Context, pool *pb.Pool) (map[string]int, error)
+
+	Close() error
+	HealthCheck(ctx context.Context) error
+}
+
+// newBackend selects the Service implementation to use based on the
+// backend.type config key. Existing deployments are unaffected: an unset key
+// still resolves to the redis backend.
+func newBackend(cfg config.View) (Service, error) {
+	switch backendType := cfg.GetString("backend.type"); backendType {
+	case "", "redis":
+		return newRedisBackend(cfg)
+	case "etcd":
+		return newEtcdBackend(cfg)
+	default:
+		return nil, errors.Errorf("unknown backend.type %q, expected \"redis\" or \"etcd\"", backendType)
+	}
+}
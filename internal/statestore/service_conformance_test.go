@@ -0,0 +1,153 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v3"
+	"github.com/go-redis/redis/v9"
+	"github.com/golang/protobuf/ptypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"open-match.dev/open-match/pkg/pb"
+)
+
+// TestServiceConformance runs the same Backfill lifecycle assertions against
+// every Service implementation, so a behavior change in one backend that
+// isn't mirrored in the other (e.g. whether CreateBackfill indexes) gets
+// caught here instead of by callers noticing the two backends disagree.
+func TestServiceConformance(t *testing.T) {
+	backends := map[string]func(t *testing.T) Service{
+		"redis": newConformanceRedisBackend,
+		"etcd":  newConformanceEtcdBackend,
+	}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			svc := newBackend(t)
+			testServiceBackfillLifecycle(t, svc)
+		})
+	}
+}
+
+func testServiceBackfillLifecycle(t *testing.T, svc Service) {
+	ctx := context.Background()
+
+	backfill := &pb.Backfill{Id: "conformance-backfill", Generation: 1}
+
+	require.NoError(t, svc.CreateBackfill(ctx, backfill, []string{"ticket-1"}))
+
+	t.Run("create is idempotent-rejecting", func(t *testing.T) {
+		err := svc.CreateBackfill(ctx, backfill, nil)
+		require.Error(t, err)
+		require.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("create does not index", func(t *testing.T) {
+		indexed, err := svc.GetIndexedBackfills(ctx)
+		require.NoError(t, err)
+		require.NotContains(t, indexed, backfill.GetId())
+	})
+
+	got, ticketIDs, err := svc.GetBackfill(ctx, backfill.GetId())
+	require.NoError(t, err)
+	require.Equal(t, backfill.GetId(), got.GetId())
+	require.Equal(t, []string{"ticket-1"}, ticketIDs)
+
+	t.Run("index then query", func(t *testing.T) {
+		require.NoError(t, svc.IndexBackfill(ctx, backfill))
+		indexed, err := svc.GetIndexedBackfills(ctx)
+		require.NoError(t, err)
+		require.Contains(t, indexed, backfill.GetId())
+
+		require.NoError(t, svc.DeindexBackfill(ctx, backfill.GetId()))
+		indexed, err = svc.GetIndexedBackfills(ctx)
+		require.NoError(t, err)
+		require.NotContains(t, indexed, backfill.GetId())
+	})
+
+	t.Run("update does not index a deindexed backfill", func(t *testing.T) {
+		backfill.Generation = 2
+		require.NoError(t, svc.UpdateBackfill(ctx, backfill, []string{"ticket-1", "ticket-2"}))
+		got, ticketIDs, err := svc.GetBackfill(ctx, backfill.GetId())
+		require.NoError(t, err)
+		require.EqualValues(t, 2, got.GetGeneration())
+		require.Equal(t, []string{"ticket-1", "ticket-2"}, ticketIDs)
+
+		indexed, err := svc.GetIndexedBackfills(ctx)
+		require.NoError(t, err)
+		require.NotContains(t, indexed, backfill.GetId(),
+			"updating a deindexed backfill must not silently reindex it")
+	})
+
+	t.Run("create-time filter excludes a backfill with no create time", func(t *testing.T) {
+		require.NoError(t, svc.IndexBackfill(ctx, backfill))
+		t.Cleanup(func() { require.NoError(t, svc.DeindexBackfill(ctx, backfill.GetId())) })
+
+		after := ptypes.TimestampNow()
+		matched, err := svc.QueryIndexedBackfills(ctx, &pb.Pool{CreatedAfter: after})
+		require.NoError(t, err)
+		require.NotContains(t, matched, backfill.GetId())
+	})
+
+	require.NoError(t, svc.AcknowledgeBackfill(ctx, backfill.GetId()))
+
+	require.NoError(t, svc.DeleteBackfill(ctx, backfill.GetId()))
+	_, _, err = svc.GetBackfill(ctx, backfill.GetId())
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	require.NoError(t, svc.DeleteBackfill(ctx, backfill.GetId()), "deleting a missing backfill is not an error")
+}
+
+func newConformanceRedisBackend(t *testing.T) Service {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	v := viper.New()
+	v.Set("pendingReleaseTimeout", "1s")
+	return &redisBackend{rdb: rdb, cfg: v}
+}
+
+// newConformanceEtcdBackend requires a real etcd reachable at OM_TEST_ETCD_ENDPOINT,
+// since there is no embedded etcd server available to this package's test
+// dependencies. It is skipped by default so `go test ./...` doesn't require
+// etcd to be running.
+func newConformanceEtcdBackend(t *testing.T) Service {
+	t.Helper()
+
+	endpoint := os.Getenv("OM_TEST_ETCD_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("set OM_TEST_ETCD_ENDPOINT to run the etcd backend against a live etcd server")
+	}
+
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	v := viper.New()
+	v.Set("pendingReleaseTimeout", "1s")
+	return &etcdBackend{client: client, cfg: v}
+}